@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"time"
+
+	cgm "github.com/circonus-labs/circonus-gometrics/v3"
+)
+
+// CirconusSink is a Sink which forwards request/response counts and response
+// latencies to Circonus via circonus-gometrics. Flushing is delegated to the
+// schedule already configured on the underlying client.
+type CirconusSink struct {
+	metrics *cgm.CirconusMetrics
+	prefix  string
+}
+
+// NewCirconusSink returns a CirconusSink which records metrics against m,
+// naming them with the given prefix.
+func NewCirconusSink(m *cgm.CirconusMetrics, prefix string) *CirconusSink {
+	return &CirconusSink{metrics: m, prefix: prefix}
+}
+
+// RecordRequest increments the "requests" metric.
+func (s *CirconusSink) RecordRequest() { s.metrics.Increment(s.prefix + ".requests") }
+
+// RecordResponse increments the "responses" metric.
+func (s *CirconusSink) RecordResponse() { s.metrics.Increment(s.prefix + ".responses") }
+
+// RecordLatency records d, in milliseconds, against the "latency" metric.
+func (s *CirconusSink) RecordLatency(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.metrics.Timing(s.prefix+".latency", ms)
+}
+
+// Flush submits any metrics buffered by the underlying CirconusMetrics
+// client to the Circonus broker.
+func (s *CirconusSink) Flush() error {
+	s.metrics.Flush()
+	return nil
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// minuteCounter is a counter which resets to zero at the start of every
+// one-minute window, so that its value reports events seen in roughly the
+// last minute rather than an ever-growing total.
+type minuteCounter struct {
+	count uint64
+}
+
+func newMinuteCounter() *minuteCounter {
+	c := &minuteCounter{}
+	go c.rotate(1 * time.Minute)
+	return c
+}
+
+// inc atomically increments the counter.
+func (c *minuteCounter) inc() { atomic.AddUint64(&c.count, 1) }
+
+// value returns the counter's current value.
+func (c *minuteCounter) value() uint64 { return atomic.LoadUint64(&c.count) }
+
+// rotate resets the counter to zero every period.
+func (c *minuteCounter) rotate(period time.Duration) {
+	for range time.Tick(period) {
+		atomic.StoreUint64(&c.count, 0)
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GraphiteSink is a Sink which periodically flushes request/response counts
+// and latency quantiles to a Graphite carbon server, using the plaintext
+// protocol ("<prefix>.<metric> <value> <unix-timestamp>\n"). The connection
+// is established lazily and reopened on write failure.
+type GraphiteSink struct {
+	addr   string
+	prefix string
+
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+
+	reqs, resps uint64
+	*histogram
+}
+
+// NewGraphiteSink returns a GraphiteSink which flushes to addr every period,
+// prefixing every metric name with prefix.
+func NewGraphiteSink(addr, prefix string, period time.Duration) *GraphiteSink {
+	s := &GraphiteSink{addr: addr, prefix: prefix, histogram: newHistogram(5, 1, 1000*60*3, 3)}
+	go s.loop(period)
+	return s
+}
+
+// RecordRequest atomically increments the sink's request counter.
+func (s *GraphiteSink) RecordRequest() { atomic.AddUint64(&s.reqs, 1) }
+
+// RecordResponse atomically increments the sink's response counter.
+func (s *GraphiteSink) RecordResponse() { atomic.AddUint64(&s.resps, 1) }
+
+// RecordLatency records d, in milliseconds, into the sink's latency
+// histogram.
+func (s *GraphiteSink) RecordLatency(d time.Duration) { s.histogram.record(millis(d)) }
+
+// loop calls Flush every period, logging (rather than surfacing) failures,
+// since it runs detached from any caller.
+func (s *GraphiteSink) loop(period time.Duration) {
+	for range time.Tick(period) {
+		if err := s.Flush(); err != nil {
+			log.Printf("metrics: graphite flush to %s failed: %v", s.addr, err)
+		}
+	}
+}
+
+// Flush writes the current counters and latency quantiles to the Graphite
+// server, (re)connecting first if there is no live connection.
+func (s *GraphiteSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn, s.w = conn, bufio.NewWriter(conn)
+	}
+
+	now := time.Now().Unix()
+	lines := []string{
+		fmt.Sprintf("%s.requests %d %d\n", s.prefix, atomic.LoadUint64(&s.reqs), now),
+		fmt.Sprintf("%s.responses %d %d\n", s.prefix, atomic.LoadUint64(&s.resps), now),
+	}
+	for name, value := range s.histogram.quantiles() {
+		lines = append(lines, fmt.Sprintf("%s.latency.%s %d %d\n", s.prefix, name, value, now))
+	}
+
+	for _, line := range lines {
+		if _, err := s.w.WriteString(line); err != nil {
+			s.conn.Close()
+			s.conn, s.w = nil, nil
+			return err
+		}
+	}
+
+	if err := s.w.Flush(); err != nil {
+		s.conn.Close()
+		s.conn, s.w = nil, nil
+		return err
+	}
+
+	return nil
+}
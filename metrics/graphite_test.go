@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphiteSinkFlush(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	lines := make(chan string, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	s := NewGraphiteSink(ln.Addr().String(), "myapp", time.Hour)
+	s.RecordRequest()
+	s.RecordRequest()
+	s.RecordResponse()
+	s.RecordLatency(42 * time.Millisecond)
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for len(got) < 2 {
+		select {
+		case line := <-lines:
+			got = append(got, line)
+		case <-timeout:
+			t.Fatalf("timed out waiting for flushed lines, got: %v", got)
+		}
+	}
+
+	joined := strings.Join(got, "")
+	if !strings.Contains(joined, "myapp.requests 2 ") {
+		t.Errorf("missing requests line in %q", joined)
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+)
+
+// histogramBuckets is the number of fixed-width (on a log scale) buckets
+// each bucketHistogram maintains. It trades some quantile precision in the
+// lock-free hot path for an allocation-free, contention-free record: bucket
+// counts are merged into the windowed HDR histogram once a minute, in
+// rotateOnce, each at its bucket's lower bound, so quantiles are only as
+// precise as these buckets.
+const histogramBuckets = 128
+
+// bucketHistogram is a lock-free accumulator of observations onto a fixed
+// set of log-scale buckets between min and max. Recording an observation is
+// a single bucket index computation plus a handful of atomic.AddUint64
+// calls, with no locking and no allocation.
+type bucketHistogram struct {
+	min, max int64
+	scale    float64
+	counts   [histogramBuckets]uint64
+}
+
+func newBucketHistogram(min, max int64) *bucketHistogram {
+	return &bucketHistogram{
+		min:   min,
+		max:   max,
+		scale: float64(histogramBuckets-1) / math.Log(float64(max)/float64(min)),
+	}
+}
+
+// indexOf returns the bucket index covering value, clamped to the
+// configured [min, max] range.
+func (b *bucketHistogram) indexOf(value int64) int {
+	switch {
+	case value <= b.min:
+		return 0
+	case value >= b.max:
+		return histogramBuckets - 1
+	default:
+		return int(math.Log(float64(value)/float64(b.min)) * b.scale)
+	}
+}
+
+// valueOf returns the representative value (the lower bound) of the bucket
+// at idx, used when merging bucket counts back into an hdrhistogram.Histogram.
+func (b *bucketHistogram) valueOf(idx int) int64 {
+	return int64(float64(b.min) * math.Exp(float64(idx)/b.scale))
+}
+
+// observe atomically records value in its bucket.
+func (b *bucketHistogram) observe(value int64) {
+	atomic.AddUint64(&b.counts[b.indexOf(value)], 1)
+}
+
+// reset zeroes every bucket. Callers must ensure no observer is still
+// writing to b when this is called.
+func (b *bucketHistogram) reset() {
+	for i := range b.counts {
+		atomic.StoreUint64(&b.counts[i], 0)
+	}
+}
+
+// hotBit is the bit of histogram.state that selects which bucketHistogram
+// is currently hot; the remaining bits count reservations made against the
+// current generation since the last rotateOnce.
+const hotBit = uint64(1) << 63
+
+// histogram is a lock-free latency (or other magnitude) accumulator backed
+// by two bucketHistogram instances, "hot" and "cold". record always
+// observes into the current hot instance, never blocking. Once a minute,
+// rotateOnce swaps hot and cold, waits for observers already committed to
+// the new cold instance to finish, merges its bucket counts into a windowed
+// HDR histogram, and resets it for reuse.
+//
+// Picking the hot instance and registering intent to observe into it are
+// combined into the single atomic.AddUint64 in record, rather than being two
+// separate atomic operations. That closes the race a split load-then-add
+// would otherwise have: rotateOnce would be able to observe zero in-flight
+// writers for a generation and reclaim it while a record call that read the
+// old hot index just before the flip was still about to write into it.
+// NOTE(tsenart): Memory must be 64bit aligned on ARM and x86-32
+// or a runtime panic will occur in some platforms when using atomic operations.
+// See: http://golang.org/src/pkg/sync/atomic/doc.go#L52
+type histogram struct {
+	state     uint64    // hotBit selects the hot generation; the rest counts reservations against it
+	completed [2]uint64 // count of record calls that finished writing into each generation
+	buckets   [2]*bucketHistogram
+
+	mu       sync.Mutex // guards windowed; record never takes it
+	windowed *hdrhistogram.WindowedHistogram
+}
+
+// newHistogram returns a histogram which rotates itself once a minute.
+func newHistogram(n int, minValue, maxValue int64, sigfigs int) *histogram {
+	h := newHistogramNoRotate(n, minValue, maxValue, sigfigs)
+	go h.rotate(1 * time.Minute)
+	return h
+}
+
+// newHistogramNoRotate returns a histogram which never rotates on its own;
+// the caller is responsible for calling rotateOnce periodically. It exists
+// for callers such as WrapWithRouter that track many histograms (one pair
+// per route) and want to drive their rotation from a single shared ticker
+// rather than spawning one goroutine per histogram (two per route).
+func newHistogramNoRotate(n int, minValue, maxValue int64, sigfigs int) *histogram {
+	return &histogram{
+		buckets:  [2]*bucketHistogram{newBucketHistogram(minValue, maxValue), newBucketHistogram(minValue, maxValue)},
+		windowed: hdrhistogram.NewWindowed(n, minValue, maxValue, sigfigs),
+	}
+}
+
+// record observes value, in whatever unit the histogram was configured with
+// (e.g. milliseconds for a latency histogram), into the current hot bucket
+// histogram. It never blocks: the only synchronization is the single
+// atomic.AddUint64 that both picks the hot generation and reserves a slot in
+// it, followed by an atomic.AddUint64 marking that reservation complete.
+func (h *histogram) record(value int64) {
+	n := atomic.AddUint64(&h.state, 1)
+	idx := (n & hotBit) >> 63
+	h.buckets[idx].observe(value)
+	atomic.AddUint64(&h.completed[idx], 1)
+}
+
+// rotateOnce flips the hot generation, waits for every record call that
+// reserved a slot against the generation that just went cold to finish
+// writing, merges its bucket counts into the windowed HDR histogram, rotates
+// that, and resets the cold bucket for reuse as the next hot one.
+func (h *histogram) rotateOnce() {
+	var old uint64
+	for {
+		old = atomic.LoadUint64(&h.state)
+		next := (old & hotBit) ^ hotBit // flip the hot bit, reservations reset to 0
+		if atomic.CompareAndSwapUint64(&h.state, old, next) {
+			break
+		}
+	}
+
+	cur := (old & hotBit) >> 63
+	reservations := old &^ hotBit
+
+	for atomic.LoadUint64(&h.completed[cur]) < reservations {
+		runtime.Gosched()
+	}
+	atomic.StoreUint64(&h.completed[cur], 0)
+
+	cold := h.buckets[cur]
+
+	h.mu.Lock()
+	for i := range cold.counts {
+		if n := atomic.LoadUint64(&cold.counts[i]); n > 0 {
+			h.windowed.Current.RecordValues(cold.valueOf(i), int64(n))
+		}
+	}
+	h.windowed.Rotate()
+	h.mu.Unlock()
+
+	cold.reset()
+}
+
+// rotate calls rotateOnce every period, for histograms managing their own
+// rotation goroutine.
+func (h *histogram) rotate(period time.Duration) {
+	for range time.Tick(period) {
+		h.rotateOnce()
+	}
+}
+
+// quantiles merges the windowed histogram's buckets and returns the set of
+// latency quantiles published by Wrap's expvar snapshot.
+func (h *histogram) quantiles() map[string]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m := h.windowed.Merge()
+
+	return map[string]int64{
+		"P50":  m.ValueAtQuantile(50),
+		"P75":  m.ValueAtQuantile(75),
+		"P90":  m.ValueAtQuantile(90),
+		"P95":  m.ValueAtQuantile(95),
+		"P99":  m.ValueAtQuantile(99),
+		"P999": m.ValueAtQuantile(99.9),
+	}
+}
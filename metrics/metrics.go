@@ -1,108 +1,95 @@
 // Package metrics provides an HTTP handler which registers expvar counters for
 // the number of requests received and responses sent as well as quantiles of
 // the latency of responses.
+//
+// For services that scrape Prometheus rather than parse expvar JSON, WrapProm
+// exposes the same request/response/latency data as Prometheus metrics.
 package metrics
 
 import (
-	"expvar"
 	"net/http"
-	"sync"
-	"sync/atomic"
 	"time"
-
-	"github.com/codahale/hdrhistogram/hdr"
 )
 
-// Wrap returns a handler which records the number of requests received and
-// responses sent to the given handler, as well as latency quantiles for
-// responses over a five-minute window.
-//
-// These counters are published as the "http" object in expvars.
-//
-// By tracking incoming requests and outgoing responses, one can monitor not
-// only the requests per second, but also the number of requests being processed
-// at any given point in time.
-func Wrap(h http.Handler) http.Handler {
-	// a five-minute window tracking 1ms-3min
-	stats := handlerStats{histogram: newHistogram(5, 1, 1000*60*3, 3)}
-
-	expvar.Publish("http", expvar.Func(func() interface{} { return stats.snapshot() }))
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		stats.requests(1)
-		defer stats.responses(1)
-		defer stats.record(time.Now())
-		h.ServeHTTP(w, r)
-	})
-}
+// WrapOption configures the behaviour of Wrap.
+type WrapOption func(*wrapConfig)
 
-// handlerStats is a container type for several HTTP handler statistics
-// NOTE(tsenart): Memory must be 64bit aligned on ARM and x86-32
-// or a runtime panic will occur in some platforms when using atomic operations.
-// See: http://golang.org/src/pkg/sync/atomic/doc.go#L52
-type handlerStats struct {
-	reqs, resps uint64
-	*histogram
+// WithSink adds one or more Sinks to which request/response/latency events
+// are forwarded, in addition to the expvar publication Wrap always performs.
+// This lets a service fan its metrics out to e.g. Graphite or StatsD without
+// giving up the existing expvar snapshot.
+func WithSink(sinks ...Sink) WrapOption {
+	return func(c *wrapConfig) { c.sinks = append(c.sinks, sinks...) }
 }
 
-// snapshot returns a snapshot of this handlerStats
-func (s *handlerStats) snapshot() map[string]interface{} {
-	s.Lock()
-	defer s.Unlock()
-
-	m := s.Merge()
-
-	return map[string]interface{}{
-		"Requests":  s.reqs,
-		"Responses": s.responses,
-		"P50":       m.ValueAtQuantile(50),
-		"P75":       m.ValueAtQuantile(75),
-		"P90":       m.ValueAtQuantile(90),
-		"P95":       m.ValueAtQuantile(95),
-		"P99":       m.ValueAtQuantile(99),
-		"P999":      m.ValueAtQuantile(999),
+// WithSlowRequest sets the threshold above which a response is considered
+// slow, and a callback invoked with the request and its latency whenever
+// that threshold is exceeded. It is intended for logging or tracing the
+// long-tail requests the five-minute quantile snapshot obscures.
+func WithSlowRequest(threshold time.Duration, onSlow func(*http.Request, time.Duration)) WrapOption {
+	return func(c *wrapConfig) {
+		c.slowThreshold = threshold
+		c.onSlow = onSlow
 	}
 }
 
-// reqs atomically adds n to the internal requests counter
-func (s *handlerStats) requests(n uint64) uint64 {
-	return atomic.AddUint64(&s.reqs, n)
-}
-
-// resps atomically adds n to the internal responses counter
-func (s *handlerStats) responses(n uint64) uint64 {
-	return atomic.AddUint64(&s.resps, n)
-}
+// wrapConfig holds the configuration accumulated from a Wrap call's options.
+type wrapConfig struct {
+	sinks []Sink
 
-// histogram is an utility type wrapping an hdr.WindowedHistogram
-type histogram struct {
-	sync.Mutex
-	*hdr.WindowedHistogram
+	slowThreshold time.Duration
+	onSlow        func(*http.Request, time.Duration)
 }
 
-func newHistogram(n int, minValue, maxValue int64, sigfigs int) *histogram {
-	h := &histogram{
-		WindowedHistogram: hdr.NewWindowedHistogram(n, minValue, maxValue, sigfigs),
+// Wrap returns a handler which records the number of requests received and
+// responses sent to the given handler, as well as latency quantiles for
+// responses over a five-minute window.
+//
+// These counters are published as the "http" object in expvars, which also
+// exposes InFlight, MaxLatency and ErrorCount for real-time saturation
+// visibility. Additional Sinks, e.g. for Graphite or StatsD, may be attached
+// with WithSink, and WithSlowRequest can be used to log or trace individual
+// long-tail requests.
+//
+// By tracking incoming requests and outgoing responses, one can monitor not
+// only the requests per second, but also the number of requests being processed
+// at any given point in time.
+func Wrap(h http.Handler, opts ...WrapOption) http.Handler {
+	cfg := &wrapConfig{}
+	for _, opt := range opts {
+		opt(cfg)
 	}
 
-	go h.rotate(1 * time.Minute)
-
-	return h
-}
+	primary := NewExpvarSink("http")
+	sinks := append([]Sink{primary}, cfg.sinks...)
 
-// record safely updates the histogram's state with a new entry
-func (h *histogram) record(start time.Time) {
-	h.Lock()
-	elapsedMS := time.Now().Sub(start).Seconds() * 1000.0
-	h.Current.RecordValue(int64(elapsedMS))
-	h.Unlock()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range sinks {
+			s.RecordRequest()
+		}
+
+		primary.incInFlight()
+		defer primary.decInFlight()
+
+		rec := newResponseRecorder(w)
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		d := time.Since(start)
+
+		for _, s := range sinks {
+			s.RecordResponse()
+			s.RecordLatency(d)
+		}
+		primary.recordStatus(rec.statusCode())
+
+		if cfg.onSlow != nil && d > cfg.slowThreshold {
+			cfg.onSlow(r, d)
+		}
+	})
 }
 
-// rotate safely rotates the histogram every period amount of time
-func (h *histogram) rotate(period time.Duration) {
-	for _ = range time.Tick(period) {
-		h.Lock()
-		h.Rotate()
-		h.Unlock()
-	}
+// millis converts d to the millisecond resolution histograms are recorded
+// at.
+func millis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
 }
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSink is a Sink that records how many times each method was called,
+// for use in asserting Wrap fans events out to every attached Sink.
+type countingSink struct {
+	requests, responses uint64
+	latencies           uint64
+}
+
+func (s *countingSink) RecordRequest()              { atomic.AddUint64(&s.requests, 1) }
+func (s *countingSink) RecordResponse()             { atomic.AddUint64(&s.responses, 1) }
+func (s *countingSink) RecordLatency(time.Duration) { atomic.AddUint64(&s.latencies, 1) }
+func (s *countingSink) Flush() error                { return nil }
+
+func TestWrap(t *testing.T) {
+	sink := &countingSink{}
+
+	var slowCalls int32
+	var sawRequest *http.Request
+	var sawLatency time.Duration
+
+	h := Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}), WithSink(sink), WithSlowRequest(1*time.Millisecond, func(r *http.Request, d time.Duration) {
+		atomic.AddInt32(&slowCalls, 1)
+		sawRequest = r
+		sawLatency = d
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := atomic.LoadUint64(&sink.requests); got != 1 {
+		t.Errorf("sink.requests = %d, want 1", got)
+	}
+	if got := atomic.LoadUint64(&sink.responses); got != 1 {
+		t.Errorf("sink.responses = %d, want 1", got)
+	}
+	if got := atomic.LoadUint64(&sink.latencies); got != 1 {
+		t.Errorf("sink.latencies = %d, want 1", got)
+	}
+
+	if atomic.LoadInt32(&slowCalls) != 1 {
+		t.Fatalf("onSlow was not invoked for a response over the threshold")
+	}
+	if sawRequest != req {
+		t.Errorf("onSlow was not passed the original request")
+	}
+	if sawLatency < 5*time.Millisecond {
+		t.Errorf("onSlow latency = %v, want >= 5ms", sawLatency)
+	}
+}
+
+func TestMillis(t *testing.T) {
+	if got := millis(1500 * time.Microsecond); got != 1 {
+		t.Errorf("millis(1500us) = %d, want 1", got)
+	}
+	if got := millis(2 * time.Second); got != 2000 {
+		t.Errorf("millis(2s) = %d, want 2000", got)
+	}
+}
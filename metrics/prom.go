@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labeler extracts the label to associate with a request's path. Callers
+// should collapse high-cardinality paths (e.g. ones containing IDs) into a
+// bounded set of route names, since each distinct value creates a new
+// Prometheus time series.
+type Labeler func(*http.Request) string
+
+// Option configures the behaviour of WrapProm.
+type Option func(*promStats)
+
+// WithLabeler sets the function used to derive the "path" label from a
+// request. The default labeler returns r.URL.Path unmodified.
+func WithLabeler(fn Labeler) Option {
+	return func(s *promStats) { s.labeler = fn }
+}
+
+// WithBuckets sets the latency histogram's bucket boundaries, in seconds.
+// The default is prometheus.DefBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(s *promStats) { s.buckets = buckets }
+}
+
+// WithRegisterer sets the *prometheus.Registry WrapProm registers its
+// collectors against. The default is a dedicated prometheus.NewRegistry(),
+// not prometheus.DefaultRegisterer, so that calling WrapProm more than once
+// in a process (e.g. two handlers, or a test suite) never panics on
+// duplicate registration. Pass
+// prometheus.DefaultRegisterer.(*prometheus.Registry) explicitly to expose
+// these metrics on the process-wide /metrics endpoint instead.
+func WithRegisterer(reg *prometheus.Registry) Option {
+	return func(s *promStats) { s.registerer = reg }
+}
+
+// WrapProm returns a handler which records the same request/response/
+// latency data as Wrap, but exposes it as Prometheus metrics broken down by
+// method, path and status_code rather than publishing a single expvar
+// snapshot. It also returns the *prometheus.Registry the metrics were
+// registered against, so callers can mount them for scraping:
+//
+//	h, reg := metrics.WrapProm(myHandler)
+//	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+//
+// The metrics registered are:
+//
+//	http_requests_total{method,path,status_code}        counter
+//	http_requests_in_flight{method,path}                 gauge
+//	http_response_size_bytes{method,path,status_code}    histogram
+//	http_request_duration_seconds{method,path,status_code} histogram
+func WrapProm(h http.Handler, opts ...Option) (http.Handler, *prometheus.Registry) {
+	s := &promStats{
+		labeler:    func(r *http.Request) string { return r.URL.Path },
+		buckets:    prometheus.DefBuckets,
+		registerer: prometheus.NewRegistry(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.requests = registerCounterVec(s.registerer, prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Total number of HTTP requests received, by method, path and status code.",
+	}, []string{"method", "path", "status_code"})
+
+	s.inFlight = registerGaugeVec(s.registerer, prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "Number of HTTP requests currently being processed, by method and path.",
+	}, []string{"method", "path"})
+
+	s.responseSize = registerHistogramVec(s.registerer, prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of HTTP responses in bytes, by method, path and status code.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+	}, []string{"method", "path", "status_code"})
+
+	s.latency = registerHistogramVec(s.registerer, prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP responses in seconds, by method, path and status code.",
+		Buckets: s.buckets,
+	}, []string{"method", "path", "status_code"})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := s.labeler(r)
+
+		inFlight := s.inFlight.WithLabelValues(r.Method, path)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rec := newResponseRecorder(w)
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		status := strconv.Itoa(rec.statusCode())
+		s.requests.WithLabelValues(r.Method, path, status).Inc()
+		s.responseSize.WithLabelValues(r.Method, path, status).Observe(float64(rec.bytesWritten()))
+		s.latency.WithLabelValues(r.Method, path, status).Observe(elapsed.Seconds())
+	}), s.registerer
+}
+
+// promStats holds the Prometheus collectors and configuration backing
+// WrapProm.
+type promStats struct {
+	labeler    Labeler
+	buckets    []float64
+	registerer *prometheus.Registry
+
+	requests     *prometheus.CounterVec
+	inFlight     *prometheus.GaugeVec
+	responseSize *prometheus.HistogramVec
+	latency      *prometheus.HistogramVec
+}
+
+// registerCounterVec registers a new CounterVec against reg, reusing the
+// already-registered collector instead of panicking if one with the same
+// name was registered before, so that calling WrapProm more than once
+// against the same Registerer is safe.
+func registerCounterVec(reg prometheus.Registerer, opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(opts, labels)
+	if err := reg.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.CounterVec)
+		}
+		panic(err)
+	}
+	return c
+}
+
+// registerGaugeVec is registerCounterVec for GaugeVec.
+func registerGaugeVec(reg prometheus.Registerer, opts prometheus.GaugeOpts, labels []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(opts, labels)
+	if err := reg.Register(g); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.GaugeVec)
+		}
+		panic(err)
+	}
+	return g
+}
+
+// registerHistogramVec is registerCounterVec for HistogramVec.
+func registerHistogramVec(reg prometheus.Registerer, opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(opts, labels)
+	if err := reg.Register(h); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector.(*prometheus.HistogramVec)
+		}
+		panic(err)
+	}
+	return h
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWrapProm(t *testing.T) {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hi"))
+	})
+
+	h, reg := WrapProm(inner)
+
+	req := httptest.NewRequest(http.MethodGet, "/brew", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetCounter().GetValue() == 1 {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Fatal("http_requests_total counter was not incremented")
+	}
+}
+
+func TestWrapPromCalledTwiceDoesNotPanic(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("second WrapProm call against the same registry panicked: %v", r)
+		}
+	}()
+
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	WrapProm(noop, WithRegisterer(reg))
+	WrapProm(noop, WithRegisterer(reg))
+}
+
+func TestWrapPromLabeler(t *testing.T) {
+	var gotPath string
+	h, _ := WrapProm(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithLabeler(func(r *http.Request) string {
+			gotPath = "custom"
+			return "custom"
+		}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/anything", nil))
+
+	if gotPath != "custom" {
+		t.Fatalf("labeler was not invoked")
+	}
+}
+
+func TestWrapPromBuckets(t *testing.T) {
+	h, reg := WrapProm(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithBuckets([]float64{0.1, 0.2}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			buckets := m.GetHistogram().GetBucket()
+			if len(buckets) != 2 {
+				t.Fatalf("got %d buckets, want 2", len(buckets))
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("http_request_duration_seconds histogram not found")
+	}
+}
+
+func TestWrapPromStatusCodeLabel(t *testing.T) {
+	h, reg := WrapProm(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "status_code" && lp.GetValue() == "404" {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatal("status_code label was not set to 404")
+	}
+}
+
+func TestWrapPromPathLabelDefault(t *testing.T) {
+	h, reg := WrapProm(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/some/path", nil))
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "path" && strings.Contains(lp.GetValue(), "/some/path") {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatal("path label did not default to the request's URL path")
+	}
+}
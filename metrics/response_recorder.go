@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// recorder is the interface newResponseRecorder returns: an http.ResponseWriter
+// that also exposes the status code and byte count it captured.
+type recorder interface {
+	http.ResponseWriter
+	statusCode() int
+	bytesWritten() int
+}
+
+// recorderCore implements the status/byte-count bookkeeping shared by every
+// responseRecorder variant below. It is never used as an http.ResponseWriter
+// on its own when w implements any of http.Flusher, http.Hijacker,
+// http.CloseNotifier or http.Pusher; newResponseRecorder instead picks the
+// variant that implements exactly the subset w supports.
+type recorderCore struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader records status before delegating to the wrapped writer.
+func (r *recorderCore) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written before delegating to the
+// wrapped writer.
+func (r *recorderCore) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+func (r *recorderCore) statusCode() int   { return r.status }
+func (r *recorderCore) bytesWritten() int { return r.size }
+
+// newResponseRecorder wraps w, recording the status code and number of
+// bytes written to it, in a variant that implements exactly the subset of
+// http.Flusher, http.Hijacker, http.CloseNotifier and http.Pusher that w
+// itself implements. This feature-detecting composition (the same
+// technique used by github.com/felixge/httpsnoop) ensures a caller's type
+// assertion against the returned writer succeeds or fails exactly as it
+// would against w directly, rather than always succeeding.
+//
+// Its status defaults to http.StatusOK, matching what net/http assumes when
+// a handler never calls WriteHeader.
+func newResponseRecorder(w http.ResponseWriter) recorder {
+	core := recorderCore{ResponseWriter: w, status: http.StatusOK}
+
+	_, isFlusher := w.(http.Flusher)
+	_, isHijacker := w.(http.Hijacker)
+	_, isCloseNotifier := w.(http.CloseNotifier)
+	_, isPusher := w.(http.Pusher)
+
+	switch {
+	case isFlusher && isHijacker && isCloseNotifier && isPusher:
+		return &recorderFHCP{core}
+	case isFlusher && isHijacker && isCloseNotifier:
+		return &recorderFHC{core}
+	case isFlusher && isHijacker && isPusher:
+		return &recorderFHP{core}
+	case isFlusher && isCloseNotifier && isPusher:
+		return &recorderFCP{core}
+	case isHijacker && isCloseNotifier && isPusher:
+		return &recorderHCP{core}
+	case isFlusher && isHijacker:
+		return &recorderFH{core}
+	case isFlusher && isCloseNotifier:
+		return &recorderFC{core}
+	case isFlusher && isPusher:
+		return &recorderFP{core}
+	case isHijacker && isCloseNotifier:
+		return &recorderHC{core}
+	case isHijacker && isPusher:
+		return &recorderHP{core}
+	case isCloseNotifier && isPusher:
+		return &recorderCP{core}
+	case isFlusher:
+		return &recorderF{core}
+	case isHijacker:
+		return &recorderH{core}
+	case isCloseNotifier:
+		return &recorderC{core}
+	case isPusher:
+		return &recorderP{core}
+	default:
+		return &core
+	}
+}
+
+func (r *recorderCore) flush() { r.ResponseWriter.(http.Flusher).Flush() }
+
+func (r *recorderCore) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (r *recorderCore) closeNotify() <-chan bool {
+	return r.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (r *recorderCore) push(target string, opts *http.PushOptions) error {
+	return r.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// The types below each embed recorderCore and add exactly the combination of
+// optional interfaces their name spells out: F=Flusher, H=Hijacker,
+// C=CloseNotifier, P=Pusher. They exist solely so newResponseRecorder can
+// return a writer whose interface set matches the one it wraps.
+
+type recorderF struct{ recorderCore }
+
+func (r *recorderF) Flush() { r.flush() }
+
+type recorderH struct{ recorderCore }
+
+func (r *recorderH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+
+type recorderC struct{ recorderCore }
+
+func (r *recorderC) CloseNotify() <-chan bool { return r.closeNotify() }
+
+type recorderP struct{ recorderCore }
+
+func (r *recorderP) Push(target string, opts *http.PushOptions) error { return r.push(target, opts) }
+
+type recorderFH struct{ recorderCore }
+
+func (r *recorderFH) Flush()                                       { r.flush() }
+func (r *recorderFH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+
+type recorderFC struct{ recorderCore }
+
+func (r *recorderFC) Flush()                   { r.flush() }
+func (r *recorderFC) CloseNotify() <-chan bool { return r.closeNotify() }
+
+type recorderFP struct{ recorderCore }
+
+func (r *recorderFP) Flush() { r.flush() }
+func (r *recorderFP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderHC struct{ recorderCore }
+
+func (r *recorderHC) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderHC) CloseNotify() <-chan bool                     { return r.closeNotify() }
+
+type recorderHP struct{ recorderCore }
+
+func (r *recorderHP) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderHP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderCP struct{ recorderCore }
+
+func (r *recorderCP) CloseNotify() <-chan bool { return r.closeNotify() }
+func (r *recorderCP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderFHC struct{ recorderCore }
+
+func (r *recorderFHC) Flush()                                       { r.flush() }
+func (r *recorderFHC) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderFHC) CloseNotify() <-chan bool                     { return r.closeNotify() }
+
+type recorderFHP struct{ recorderCore }
+
+func (r *recorderFHP) Flush()                                       { r.flush() }
+func (r *recorderFHP) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderFHP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderFCP struct{ recorderCore }
+
+func (r *recorderFCP) Flush()                   { r.flush() }
+func (r *recorderFCP) CloseNotify() <-chan bool { return r.closeNotify() }
+func (r *recorderFCP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderHCP struct{ recorderCore }
+
+func (r *recorderHCP) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderHCP) CloseNotify() <-chan bool                     { return r.closeNotify() }
+func (r *recorderHCP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
+
+type recorderFHCP struct{ recorderCore }
+
+func (r *recorderFHCP) Flush()                                       { r.flush() }
+func (r *recorderFHCP) Hijack() (net.Conn, *bufio.ReadWriter, error) { return r.hijack() }
+func (r *recorderFHCP) CloseNotify() <-chan bool                     { return r.closeNotify() }
+func (r *recorderFHCP) Push(target string, opts *http.PushOptions) error {
+	return r.push(target, opts)
+}
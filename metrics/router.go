@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RouteKeyFunc extracts the route key to associate with a request, e.g. the
+// matched pattern ("/users/:id") rather than the raw, possibly
+// high-cardinality, URL path. As with Labeler, callers should collapse
+// high-cardinality paths into a bounded set of route names: each distinct
+// value routeStats sees creates a new, permanent map entry that is never
+// evicted.
+type RouteKeyFunc func(*http.Request) string
+
+// WrapWithRouter returns a handler which breaks down request counts, status
+// classes, response sizes and latencies by route, using route to extract a
+// route key from each request. Unlike Wrap, it records no global counters
+// and publishes nothing under the "http" expvar.
+//
+// These counters are published as the "http_routes" object in expvars,
+// keyed by route. Each route's value holds its Requests total, its
+// StatusCounts keyed by status class ("2xx", "3xx", "4xx", "5xx" or
+// "other"), and its Latency* and Size* quantiles.
+func WrapWithRouter(h http.Handler, route RouteKeyFunc) http.Handler {
+	rs := &routerStats{routes: make(map[string]*routeStats)}
+	go rs.rotate(1 * time.Minute)
+
+	expvar.Publish("http_routes", expvar.Func(func() interface{} { return rs.snapshot() }))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		elapsed := time.Since(start)
+
+		rs.record(route(r), rec.statusCode(), rec.bytesWritten(), elapsed)
+	})
+}
+
+// routerStats aggregates per-route statistics, created lazily as routes are
+// first seen. A single goroutine, started by WrapWithRouter, rotates every
+// route's histograms; routes do not each spawn their own rotation
+// goroutines, so their number stays bounded regardless of how many distinct
+// routes are seen.
+type routerStats struct {
+	mu     sync.RWMutex
+	routes map[string]*routeStats
+}
+
+// rotate calls rotateOnce on every route's histograms every period.
+func (rs *routerStats) rotate(period time.Duration) {
+	for range time.Tick(period) {
+		rs.mu.RLock()
+		for _, s := range rs.routes {
+			s.latency.rotateOnce()
+			s.size.rotateOnce()
+		}
+		rs.mu.RUnlock()
+	}
+}
+
+func (rs *routerStats) record(route string, status, size int, latency time.Duration) {
+	rs.mu.RLock()
+	s, ok := rs.routes[route]
+	rs.mu.RUnlock()
+
+	if !ok {
+		rs.mu.Lock()
+		if s, ok = rs.routes[route]; !ok {
+			s = newRouteStats()
+			rs.routes[route] = s
+		}
+		rs.mu.Unlock()
+	}
+
+	s.record(status, size, latency)
+}
+
+func (rs *routerStats) snapshot() map[string]interface{} {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	out := make(map[string]interface{}, len(rs.routes))
+	for route, s := range rs.routes {
+		out[route] = s.snapshot()
+	}
+	return out
+}
+
+// statusClasses are the buckets routeStats counts responses into, indexed
+// by statusClassIndex.
+var statusClasses = [...]string{"other", "2xx", "3xx", "4xx", "5xx"}
+
+// statusClassIndex returns the index into statusClasses for a given HTTP
+// status code.
+func statusClassIndex(status int) int {
+	if c := status / 100; c >= 2 && c <= 5 {
+		return c - 1
+	}
+	return 0
+}
+
+// routeStats tracks status class counters and latency/response-size
+// histograms for a single route.
+type routeStats struct {
+	mu      sync.Mutex
+	classes [len(statusClasses)]uint64
+
+	latency *histogram
+	size    *histogram
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{
+		// a five-minute window tracking 1ms-3min, rotated by routerStats.rotate
+		latency: newHistogramNoRotate(5, 1, 1000*60*3, 3),
+		// a five-minute window tracking 1 byte - 16MiB response bodies, rotated by routerStats.rotate
+		size: newHistogramNoRotate(5, 1, 1<<24, 3),
+	}
+}
+
+func (s *routeStats) record(status, size int, latency time.Duration) {
+	s.mu.Lock()
+	s.classes[statusClassIndex(status)]++
+	s.mu.Unlock()
+
+	s.latency.record(millis(latency))
+	s.size.record(int64(size))
+}
+
+func (s *routeStats) snapshot() map[string]interface{} {
+	s.mu.Lock()
+	classes := s.classes
+	s.mu.Unlock()
+
+	var requests uint64
+	statusCounts := make(map[string]uint64, len(statusClasses))
+	for i, n := range classes {
+		statusCounts[statusClasses[i]] = n
+		requests += n
+	}
+
+	out := map[string]interface{}{
+		"Requests":     requests,
+		"StatusCounts": statusCounts,
+	}
+	for k, v := range s.latency.quantiles() {
+		out["Latency"+k] = v
+	}
+	for k, v := range s.size.quantiles() {
+		out["Size"+k] = v
+	}
+
+	return out
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterStatsRecordsByRouteAndStatusClass(t *testing.T) {
+	rs := &routerStats{routes: make(map[string]*routeStats)}
+
+	rs.record("/users/:id", http.StatusOK, 128, 0)
+	rs.record("/users/:id", http.StatusNotFound, 64, 0)
+	rs.record("/orders/:id", http.StatusInternalServerError, 32, 0)
+
+	if n := len(rs.routes); n != 2 {
+		t.Fatalf("got %d routes, want 2", n)
+	}
+
+	users := rs.routes["/users/:id"]
+	users.mu.Lock()
+	classes := users.classes
+	users.mu.Unlock()
+
+	if got := classes[statusClassIndex(http.StatusOK)]; got != 1 {
+		t.Errorf("2xx count for /users/:id = %d, want 1", got)
+	}
+	if got := classes[statusClassIndex(http.StatusNotFound)]; got != 1 {
+		t.Errorf("4xx count for /users/:id = %d, want 1", got)
+	}
+
+	orders := rs.routes["/orders/:id"]
+	orders.mu.Lock()
+	classes = orders.classes
+	orders.mu.Unlock()
+
+	if got := classes[statusClassIndex(http.StatusInternalServerError)]; got != 1 {
+		t.Errorf("5xx count for /orders/:id = %d, want 1", got)
+	}
+}
+
+func TestRouterStatsSnapshot(t *testing.T) {
+	rs := &routerStats{routes: make(map[string]*routeStats)}
+	rs.record("/users/:id", http.StatusOK, 128, 0)
+
+	snap := rs.snapshot()
+	route, ok := snap["/users/:id"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("snapshot missing /users/:id route")
+	}
+
+	if got := route["Requests"].(uint64); got != 1 {
+		t.Errorf("Requests = %v, want 1", got)
+	}
+}
+
+func TestWrapWithRouterRecordsRequests(t *testing.T) {
+	route := func(r *http.Request) string { return r.URL.Path }
+	h := WrapWithRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), route)
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	snap := expvar.Get("http_routes").(expvar.Func).Value().(map[string]interface{})
+	ping, ok := snap["/ping"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("http_routes snapshot missing /ping route")
+	}
+	if got := ping["Requests"].(uint64); got != 1 {
+		t.Errorf("Requests for /ping = %v, want 1", got)
+	}
+}
+
+func TestStatusClassIndex(t *testing.T) {
+	cases := map[int]string{
+		0:   "other",
+		199: "other",
+		200: "2xx",
+		301: "3xx",
+		404: "4xx",
+		503: "5xx",
+		600: "other",
+	}
+	for status, want := range cases {
+		if got := statusClasses[statusClassIndex(status)]; got != want {
+			t.Errorf("statusClassIndex(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives request/response/latency events recorded by Wrap and is
+// responsible for aggregating and exposing them to a particular backend.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	// RecordRequest records a single incoming request.
+	RecordRequest()
+	// RecordResponse records a single outgoing response.
+	RecordResponse()
+	// RecordLatency records the latency of a single response.
+	RecordLatency(d time.Duration)
+	// Flush pushes any buffered state to the underlying backend and must
+	// return promptly. Wrap never calls it; a Sink that buffers state, such
+	// as GraphiteSink, calls it periodically itself.
+	Flush() error
+}
+
+// expvarSink is the Sink Wrap always registers: it publishes request and
+// response counts alongside five-minute latency quantiles as an expvar
+// object. It requires no periodic Flush, since expvar pulls its value on
+// demand.
+//
+// It also tracks a handful of real-time saturation signals that Wrap
+// maintains directly: the number of requests currently in flight, the
+// largest latency observed so far, and the number of 5xx responses seen in
+// the current minute.
+// NOTE(tsenart): Memory must be 64bit aligned on ARM and x86-32
+// or a runtime panic will occur in some platforms when using atomic operations.
+// See: http://golang.org/src/pkg/sync/atomic/doc.go#L52
+type expvarSink struct {
+	reqs, resps  uint64
+	inFlight     int64
+	maxLatencyMS int64
+	errs         *minuteCounter
+	*histogram
+}
+
+// NewExpvarSink returns a Sink which publishes name as an expvar object
+// exposing request/response counters and latency quantiles over a
+// five-minute window.
+func NewExpvarSink(name string) *expvarSink {
+	s := &expvarSink{histogram: newHistogram(5, 1, 1000*60*3, 3), errs: newMinuteCounter()}
+	expvar.Publish(name, expvar.Func(func() interface{} { return s.snapshot() }))
+	return s
+}
+
+// RecordRequest atomically increments the sink's request counter.
+func (s *expvarSink) RecordRequest() { atomic.AddUint64(&s.reqs, 1) }
+
+// RecordResponse atomically increments the sink's response counter.
+func (s *expvarSink) RecordResponse() { atomic.AddUint64(&s.resps, 1) }
+
+// RecordLatency records d, in milliseconds, into the sink's latency
+// histogram, and updates MaxLatency if d is the largest latency recorded so
+// far.
+func (s *expvarSink) RecordLatency(d time.Duration) {
+	s.histogram.record(millis(d))
+
+	ms := millis(d)
+	for {
+		cur := atomic.LoadInt64(&s.maxLatencyMS)
+		if ms <= cur || atomic.CompareAndSwapInt64(&s.maxLatencyMS, cur, ms) {
+			return
+		}
+	}
+}
+
+// incInFlight atomically increments the in-flight requests gauge.
+func (s *expvarSink) incInFlight() { atomic.AddInt64(&s.inFlight, 1) }
+
+// decInFlight atomically decrements the in-flight requests gauge.
+func (s *expvarSink) decInFlight() { atomic.AddInt64(&s.inFlight, -1) }
+
+// recordStatus increments ErrorCount for the current minute if status is a
+// server error.
+func (s *expvarSink) recordStatus(status int) {
+	if status >= http.StatusInternalServerError && status <= 599 {
+		s.errs.inc()
+	}
+}
+
+// Flush is a no-op: expvarSink's value is computed on demand when scraped.
+func (s *expvarSink) Flush() error { return nil }
+
+// snapshot returns a snapshot of this expvarSink's counters, latency
+// quantiles and saturation signals.
+func (s *expvarSink) snapshot() map[string]interface{} {
+	out := map[string]interface{}{
+		"Requests":   atomic.LoadUint64(&s.reqs),
+		"Responses":  atomic.LoadUint64(&s.resps),
+		"InFlight":   atomic.LoadInt64(&s.inFlight),
+		"MaxLatency": time.Duration(atomic.LoadInt64(&s.maxLatencyMS)) * time.Millisecond,
+		"ErrorCount": s.errs.value(),
+	}
+
+	for k, v := range s.histogram.quantiles() {
+		out[k] = v
+	}
+
+	return out
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// StatsDSink is a Sink which sends request/response counts and response
+// latencies to a StatsD server over UDP, one datagram per event. Unlike
+// GraphiteSink, it requires no periodic Flush: counters and timers are sent
+// as they are recorded, matching how StatsD clients are typically used.
+type StatsDSink struct {
+	prefix string
+	conn   net.Conn
+}
+
+// NewStatsDSink returns a StatsDSink which sends metrics to addr over UDP,
+// prefixing every metric name with prefix.
+func NewStatsDSink(addr, prefix string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDSink{prefix: prefix, conn: conn}, nil
+}
+
+// RecordRequest sends a "requests" counter increment.
+func (s *StatsDSink) RecordRequest() { s.send(fmt.Sprintf("%s.requests:1|c", s.prefix)) }
+
+// RecordResponse sends a "responses" counter increment.
+func (s *StatsDSink) RecordResponse() { s.send(fmt.Sprintf("%s.responses:1|c", s.prefix)) }
+
+// RecordLatency sends d, in milliseconds, as a "latency" timer.
+func (s *StatsDSink) RecordLatency(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.send(fmt.Sprintf("%s.latency:%f|ms", s.prefix, ms))
+}
+
+// Flush is a no-op: StatsDSink writes every event immediately over UDP.
+func (s *StatsDSink) Flush() error { return nil }
+
+// send best-effort writes msg to the StatsD server. StatsD is fire-and-
+// forget over UDP, so write errors are dropped rather than surfaced.
+func (s *StatsDSink) send(msg string) {
+	s.conn.Write([]byte(msg))
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsDSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	defer conn.Close()
+
+	s, err := NewStatsDSink(conn.LocalAddr().String(), "myapp")
+	if err != nil {
+		t.Fatalf("NewStatsDSink: %v", err)
+	}
+
+	s.RecordRequest()
+
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+
+	got := string(buf[:n])
+	if want := "myapp.requests:1|c"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Errorf("Flush: %v", err)
+	}
+}